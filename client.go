@@ -0,0 +1,295 @@
+package req
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// BeforeRequestHook runs just before a request built through a Client is
+// dispatched. Returning an error aborts the request without performing the
+// round trip.
+type BeforeRequestHook func(c *Client, r *Req) error
+
+// AfterResponseHook runs right after a request built through a Client comes
+// back, before Client.Do returns it to the caller.
+type AfterResponseHook func(c *Client, r *Req) error
+
+// Client carries defaults shared by every request made through it: a base
+// URL relative requests are resolved against, default Header/QueryParam
+// merged into each call (per-call values win), default Cookies sent in
+// addition to any per-call cookies, a timeout, and an
+// ordered chain of hooks run around the underlying http.Client.Do. The
+// package-level Do/Get/Post/... functions are thin wrappers around a
+// package-level default *Client.
+type Client struct {
+	HTTPClient *http.Client
+
+	// BaseURL is what any rawurl passed to Do that isn't already an
+	// absolute URL is resolved against (URL reference resolution, so a
+	// rawurl starting with "/" replaces BaseURL's path).
+	BaseURL string
+
+	Header     Header
+	QueryParam QueryParam
+	PathParam  PathParam
+	Cookies    []*http.Cookie
+
+	// Timeout bounds each request made through Do, including retries, via
+	// a context deadline; it does not replace HTTPClient.Timeout, which
+	// NewClient also sets. Zero means no additional deadline is applied.
+	Timeout time.Duration
+
+	// StrictPathParam makes Do return an error when a request URL still
+	// has an unresolved `{...}` placeholder after PathParam substitution.
+	StrictPathParam bool
+
+	// Retry configures automatic retries. The zero value never retries.
+	Retry RetryPolicy
+
+	// DefaultCodec is used by BodyAuto to marshal request bodies. JSON if
+	// unset.
+	DefaultCodec Codec
+	codecs       []registeredCodec
+
+	// DumpBodyLimit caps how many bytes of request/response body are shown
+	// by the debug dump (see Req.Format). It does not affect Req.Bytes/
+	// String/ToJSON/ToXML/Into/ToFile, which always see the full response
+	// body. For an io.Reader request body, it also caps how much is
+	// buffered for the dump while the full body still streams to the wire
+	// uncapped. Default 100 KiB; -1 means unlimited; 0 disables capture
+	// entirely.
+	DumpBodyLimit int
+
+	OnBeforeRequest []BeforeRequestHook
+	OnAfterResponse []AfterResponseHook
+}
+
+// NewClient creates a Client using the same transport/timeout/cookie-jar
+// defaults as the package-level functions.
+func NewClient() *Client {
+	jar, _ := cookiejar.New(nil)
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	c := &Client{
+		HTTPClient: &http.Client{
+			Jar:       jar,
+			Transport: transport,
+			Timeout:   2 * time.Minute,
+		},
+		Timeout:       2 * time.Minute,
+		DefaultCodec:  jsonCodec{},
+		DumpBodyLimit: 100 * 1024,
+	}
+	c.RegisterCodec(xmlCodec{})
+	c.RegisterCodec(jsonCodec{})
+	return c
+}
+
+// resolveURL resolves rawurl against c.BaseURL when rawurl is not already
+// absolute and a BaseURL is set.
+func (c *Client) resolveURL(rawurl string) (string, error) {
+	if c.BaseURL == "" {
+		return rawurl, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.IsAbs() {
+		return rawurl, nil
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// mergeArgs merges the client's default Header/QueryParam/PathParam into v,
+// with values set per-call taking precedence over the client's defaults.
+// The client's Cookies are added ahead of any per-call cookies, not
+// replaced by them.
+func (c *Client) mergeArgs(v []interface{}) []interface{} {
+	header := mergeHeader(c.Header, v)
+	query := mergeQueryParam(c.QueryParam, v)
+	pathParam := mergePathParam(c.PathParam, v)
+
+	args := make([]interface{}, 0, len(v)+len(c.Cookies)+5)
+	args = append(args, dumpLimitOpt(c.DumpBodyLimit))
+	if len(header) > 0 {
+		args = append(args, header)
+	}
+	if len(query) > 0 {
+		args = append(args, query)
+	}
+	if len(pathParam) > 0 {
+		args = append(args, pathParam)
+	}
+	for _, ck := range c.Cookies {
+		args = append(args, ck)
+	}
+	for _, item := range v {
+		switch item.(type) {
+		case Header, QueryParam, PathParam:
+			continue
+		}
+		args = append(args, item)
+	}
+	if c.StrictPathParam {
+		args = append(args, strictPathParam(true))
+	}
+	if c.HTTPClient != nil {
+		args = append(args, c.HTTPClient)
+	}
+	return args
+}
+
+func mergeHeader(base Header, v []interface{}) Header {
+	merged := make(Header, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for _, item := range v {
+		if h, ok := item.(Header); ok {
+			for key, value := range h {
+				merged[key] = value
+			}
+		}
+	}
+	return merged
+}
+
+func mergePathParam(base PathParam, v []interface{}) PathParam {
+	merged := make(PathParam, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for _, item := range v {
+		if p, ok := item.(PathParam); ok {
+			for key, value := range p {
+				merged[key] = value
+			}
+		}
+	}
+	return merged
+}
+
+func mergeQueryParam(base QueryParam, v []interface{}) QueryParam {
+	merged := make(QueryParam, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for _, item := range v {
+		if q, ok := item.(QueryParam); ok {
+			for key, value := range q {
+				merged[key] = value
+			}
+		}
+	}
+	return merged
+}
+
+// Do builds and executes a request through c: the client's default
+// Header/QueryParam are merged with the per-call values in v (per-call
+// wins) and its Cookies are added, rawurl is resolved against BaseURL,
+// OnBeforeRequest hooks run in order before the round trip, and
+// OnAfterResponse hooks run in order after it completes.
+func (c *Client) Do(method, rawurl string, v ...interface{}) (*Req, error) {
+	if rawurl == "" {
+		rawurl = c.BaseURL
+	}
+	r, err := buildReq(method, rawurl, c.mergeArgs(v)...)
+	if err != nil {
+		return r, err
+	}
+	// Resolve only after buildReq has substituted PathParam placeholders:
+	// resolving first would percent-encode their braces.
+	resolved, err := c.resolveURL(r.req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	if r.req.URL, err = url.Parse(resolved); err != nil {
+		return nil, err
+	}
+	r.owner = c
+
+	if c.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.req.Context(), c.Timeout)
+		defer func() {
+			// A response body that dispatch left unread is streamed later
+			// (e.g. by ToFile), so its deadline is left to expire on its own.
+			if r.resp == nil || r.respBody != nil {
+				cancel()
+			}
+		}()
+		r.req = r.req.WithContext(ctx)
+	}
+
+	for _, hook := range c.OnBeforeRequest {
+		if err := hook(c, r); err != nil {
+			return r, err
+		}
+	}
+
+	r, err = c.doWithRetry(r)
+	if err != nil {
+		return r, err
+	}
+
+	for _, hook := range c.OnAfterResponse {
+		if err := hook(c, r); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// Get execute a http GET request through c
+func (c *Client) Get(url string, v ...interface{}) (*Req, error) {
+	return c.Do("GET", url, v...)
+}
+
+// Post execute a http POST request through c
+func (c *Client) Post(url string, v ...interface{}) (*Req, error) {
+	return c.Do("POST", url, v...)
+}
+
+// Put execute a http PUT request through c
+func (c *Client) Put(url string, v ...interface{}) (*Req, error) {
+	return c.Do("PUT", url, v...)
+}
+
+// Patch execute a http PATCH request through c
+func (c *Client) Patch(url string, v ...interface{}) (*Req, error) {
+	return c.Do("PATCH", url, v...)
+}
+
+// Delete execute a http DELETE request through c
+func (c *Client) Delete(url string, v ...interface{}) (*Req, error) {
+	return c.Do("DELETE", url, v...)
+}
+
+// Head execute a http HEAD request through c
+func (c *Client) Head(url string, v ...interface{}) (*Req, error) {
+	return c.Do("HEAD", url, v...)
+}
+
+// Options execute a http OPTIONS request through c
+func (c *Client) Options(url string, v ...interface{}) (*Req, error) {
+	return c.Do("OPTIONS", url, v...)
+}
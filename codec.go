@@ -0,0 +1,107 @@
+package req
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Codec marshals and unmarshals request/response bodies for a set of
+// Content-Types, letting callers plug in formats such as msgpack,
+// protobuf, YAML or form-encoding without touching the core package.
+type Codec interface {
+	// ContentTypes returns the Content-Type value(s) this codec produces
+	// and recognizes, e.g. "application/json".
+	ContentTypes() []string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentTypes() []string                     { return []string{"application/json"} }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)       { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentTypes() []string                     { return []string{"application/xml", "text/xml"} }
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)       { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// registeredCodec pairs a Codec with a regex, compiled once at
+// registration time, matching the Content-Types it claims.
+type registeredCodec struct {
+	codec Codec
+	re    *regexp.Regexp
+}
+
+// RegisterCodec adds codec to c's codec registry, taking priority over
+// previously registered codecs (including the JSON/XML defaults) when
+// their ContentTypes overlap.
+func (c *Client) RegisterCodec(codec Codec) {
+	quoted := make([]string, len(codec.ContentTypes()))
+	for i, ct := range codec.ContentTypes() {
+		quoted[i] = regexp.QuoteMeta(ct)
+	}
+	c.codecs = append([]registeredCodec{{
+		codec: codec,
+		re:    regexp.MustCompile(strings.Join(quoted, "|")),
+	}}, c.codecs...)
+}
+
+// codecFor returns the first registered codec whose Content-Types match
+// contentType.
+func (c *Client) codecFor(contentType string) Codec {
+	for _, rc := range c.codecs {
+		if rc.re.MatchString(contentType) {
+			return rc.codec
+		}
+	}
+	return nil
+}
+
+// Into decodes the response body into v using the codec whose
+// ContentTypes match the response's Content-Type header, among those
+// registered on the Client that made the request (JSON and XML by
+// default). It returns an error if no codec matches.
+func (r *Req) Into(v interface{}) error {
+	client := r.owner
+	if client == nil {
+		client = defaultClient
+	}
+	var ct string
+	if r.resp != nil {
+		ct = r.resp.Header.Get("Content-Type")
+	}
+	codec := client.codecFor(ct)
+	if codec == nil {
+		return fmt.Errorf("req: no codec registered for Content-Type %q", ct)
+	}
+	return codec.Unmarshal(r.respBody, v)
+}
+
+// BodyAuto marshals v with the default client's DefaultCodec (JSON out of
+// the box) so callers can write req.Post(url, BodyAuto(payload)) without
+// choosing a serializer explicitly.
+func BodyAuto(v interface{}) interface{} {
+	return defaultClient.BodyAuto(v)
+}
+
+// BodyAuto marshals v with c's DefaultCodec (JSON if unset).
+func (c *Client) BodyAuto(v interface{}) interface{} {
+	codec := c.DefaultCodec
+	if codec == nil {
+		codec = jsonCodec{}
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return &body{
+		ContentType: codec.ContentTypes()[0] + "; charset=UTF-8",
+		Data:        data,
+	}
+}
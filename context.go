@@ -0,0 +1,23 @@
+package req
+
+import "context"
+
+// ContextKey is the type hooks and callers should use for context.WithValue
+// keys passed down through a *Req, to avoid collisions with keys used by
+// other packages.
+type ContextKey string
+
+// WithValue derives a context from r's current context (context.Background()
+// if none was set via Do) carrying key/value, and installs it on the
+// request. Intended for use from OnBeforeRequest hooks to pass values to
+// later hooks, OnAfterResponse hooks and the transport. The values stay in
+// this process; they are not sent to the server.
+func (r *Req) WithValue(key ContextKey, value interface{}) {
+	r.req = r.req.WithContext(context.WithValue(r.req.Context(), key, value))
+}
+
+// Value returns the value associated with key in r's context, or nil if
+// there is none.
+func (r *Req) Value(key ContextKey) interface{} {
+	return r.req.Context().Value(key)
+}
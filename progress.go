@@ -0,0 +1,100 @@
+package req
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"strconv"
+)
+
+// ProgressFunc is called as bytes are copied during an upload or download,
+// with written being the cumulative bytes transferred so far and total the
+// expected size (0 if unknown).
+type ProgressFunc func(written, total int64)
+
+// ProgressReader wraps an io.Reader, invoking fn after each Read with the
+// cumulative bytes read and the known total size (0 if unknown).
+type ProgressReader struct {
+	io.Reader
+	fn      ProgressFunc
+	total   int64
+	written int64
+}
+
+// NewProgressReader wraps r so fn is called after each chunk read, with
+// total being the expected size (0 if unknown).
+func NewProgressReader(r io.Reader, total int64, fn ProgressFunc) *ProgressReader {
+	return &ProgressReader{Reader: r, total: total, fn: fn}
+}
+
+func (p *ProgressReader) Read(buf []byte) (int, error) {
+	n, err := p.Reader.Read(buf)
+	if n > 0 {
+		p.written += int64(n)
+		if p.fn != nil {
+			p.fn(p.written, p.total)
+		}
+	}
+	return n, err
+}
+
+// ProgressWriter wraps an io.Writer, invoking fn after each Write with the
+// cumulative bytes written and the known total size (0 if unknown).
+type ProgressWriter struct {
+	io.Writer
+	fn      ProgressFunc
+	total   int64
+	written int64
+}
+
+// NewProgressWriter wraps w so fn is called after each chunk written, with
+// total being the expected size (0 if unknown).
+func NewProgressWriter(w io.Writer, total int64, fn ProgressFunc) *ProgressWriter {
+	return &ProgressWriter{Writer: w, total: total, fn: fn}
+}
+
+func (p *ProgressWriter) Write(buf []byte) (int, error) {
+	n, err := p.Writer.Write(buf)
+	if n > 0 {
+		p.written += int64(n)
+		if p.fn != nil {
+			p.fn(p.written, p.total)
+		}
+	}
+	return n, err
+}
+
+// multipartContentLength computes the exact Content-Length of a multipart
+// body for the given param/file parts without writing any file content: it
+// builds the same fields/headers/boundaries a real multipart.Writer using
+// boundary would produce, whose length added to the known file bytes
+// (total) gives the final size. ok is false if building the envelope fails.
+func multipartContentLength(boundary string, param []Param, file []FileUpload, total int64) (length int64, ok bool) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(boundary); err != nil {
+		return 0, false
+	}
+	for _, p := range param {
+		for key, value := range p {
+			if err := w.WriteField(key, value); err != nil {
+				return 0, false
+			}
+		}
+	}
+	i := 0
+	for _, f := range file {
+		name := f.FieldName
+		if name == "" {
+			i++
+			name = "file" + strconv.Itoa(i)
+		}
+		if _, err := w.CreateFormFile(name, f.FileName); err != nil {
+			return 0, false
+		}
+	}
+	if err := w.Close(); err != nil {
+		return 0, false
+	}
+	return int64(buf.Len()) + total, true
+}
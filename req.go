@@ -2,6 +2,7 @@ package req
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -9,9 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
-	"net"
 	"net/http"
-	"net/http/cookiejar"
 	"net/textproto"
 	"net/url"
 	"os"
@@ -31,6 +30,18 @@ type Param map[string]string
 // used to force append http request param to the uri
 type QueryParam map[string]string
 
+// PathParam replaces `{name}` placeholders in the request URL before it is
+// parsed, e.g. PathParam{"id": "42"} turns "/users/{id}" into "/users/42".
+type PathParam map[string]string
+
+// strictPathParam is set internally by Client when StrictPathParam is true;
+// it makes buildReq fail if any `{...}` placeholder is left unresolved
+// after substitution.
+type strictPathParam bool
+
+// dumpLimitOpt is set internally by Client from DumpBodyLimit.
+type dumpLimitOpt int
+
 // used for set request's Host
 type Host string
 
@@ -42,6 +53,10 @@ type FileUpload struct {
 	FieldName string
 	// file to uplaod, required
 	File io.ReadCloser
+	// Size is the file's length in bytes, used to compute upload progress
+	// and Content-Length. If zero and File is an *os.File, it is derived
+	// via os.Stat.
+	Size int64
 }
 
 // Debug enable debug mode if set to true
@@ -50,43 +65,45 @@ var Debug bool
 // ShowCost show the time spent by the request if set to true
 var ShowCost bool
 
-var defaultClient *http.Client
+// defaultClient is the Client every package-level function delegates to.
+var defaultClient *Client
 var regTextContentType = regexp.MustCompile("xml|json|text")
+var regPathParam = regexp.MustCompile(`\{[^{}]+\}`)
 
 func init() {
-	jar, _ := cookiejar.New(nil)
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-	defaultClient = &http.Client{
-		Jar:       jar,
-		Transport: transport,
-		Timeout:   2 * time.Minute,
-	}
+	defaultClient = NewClient()
 }
 
+// bodyWrapper streams a request body through to the wire unmodified while
+// capturing up to limit bytes of it (-1 unlimited, 0 disabled) for the
+// debug dump, without buffering the whole body in memory.
 type bodyWrapper struct {
 	io.ReadCloser
-	buf   bytes.Buffer
-	limit int
+	buf       bytes.Buffer
+	limit     int
+	truncated int64
 }
 
-func (b bodyWrapper) Read(p []byte) (n int, err error) {
+func (b *bodyWrapper) Read(p []byte) (n int, err error) {
 	n, err = b.ReadCloser.Read(p)
-	if left := b.limit - b.buf.Len(); left > 0 && n > 0 {
-		if n <= left {
-			b.buf.Write(p[:n])
+	if n <= 0 {
+		return
+	}
+	switch {
+	case b.limit < 0:
+		b.buf.Write(p[:n])
+	case b.limit == 0:
+		b.truncated += int64(n)
+	default:
+		if left := b.limit - b.buf.Len(); left > 0 {
+			if n <= left {
+				b.buf.Write(p[:n])
+			} else {
+				b.buf.Write(p[:left])
+				b.truncated += int64(n - left)
+			}
 		} else {
-			b.buf.Write(p[:left])
+			b.truncated += int64(n)
 		}
 	}
 	return
@@ -100,6 +117,43 @@ type Req struct {
 	reqBody  []byte
 	respBody []byte
 	cost     time.Duration
+	attempt  int
+	// multipart is true when req.Body was set by upload() as a streamed
+	// multipart pipe rather than a buffered reqBody, meaning it cannot be
+	// rewound for a retry.
+	multipart bool
+	// uploadErrCh receives the upload goroutine's outcome (nil on
+	// success) once it finishes, and is nil when there is no file upload.
+	// dispatch waits for it only after a successful round trip.
+	uploadErrCh chan error
+	// owner is the Client that built r, used by Into to look up a codec.
+	owner *Client
+	// reqCapture is set when the request body was streamed through a
+	// bodyWrapper (an io.Reader body) rather than buffered into reqBody;
+	// dump reads the captured preview from it.
+	reqCapture *bodyWrapper
+	// unbufferedBody is true when the request body cannot be rewound for
+	// a retry, e.g. a streamed io.Reader body.
+	unbufferedBody bool
+	// dumpLimit caps how many bytes of request/response body dump keeps,
+	// taken from the owning Client's DumpBodyLimit.
+	dumpLimit int
+}
+
+// Attempt returns how many times the request has been sent so far,
+// starting at 1 once dispatch has run.
+func (r *Req) Attempt() int {
+	return r.attempt
+}
+
+// rewind resets req.Body from the buffered reqBody ahead of a retry. It is
+// only called when r.multipart is false, i.e. the body is known to be
+// buffered.
+func (r *Req) rewind() {
+	if r.reqBody == nil {
+		return
+	}
+	r.req.Body = r.getReqBody()
 }
 
 func (r *Req) getReqBody() io.ReadCloser {
@@ -111,8 +165,16 @@ func (r *Req) getReqBody() io.ReadCloser {
 
 //var requestBodyLimit = 1024
 
-// Do execute request.
+// Do execute request using the default Client.
 func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
+	return defaultClient.Do(method, rawurl, v...)
+}
+
+// buildReq constructs a *Req from method, rawurl and the option values in v,
+// stopping short of actually performing the round trip. Client.Do calls this
+// with its defaults merged in, then resolves the result against its base
+// URL and runs its hook chain around dispatch.
+func buildReq(method, rawurl string, v ...interface{}) (r *Req, err error) {
 	if rawurl == "" {
 		return nil, errors.New("req: url not specified")
 	}
@@ -123,7 +185,7 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 		ProtoMajor: 1,
 		ProtoMinor: 1,
 	}
-	r = &Req{req: req}
+	r = &Req{req: req, dumpLimit: 100 * 1024}
 	handleBody := func(b *body) {
 		if b == nil {
 			return
@@ -138,7 +200,10 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 
 	var formParam []Param
 	var queryParam []QueryParam
+	var pathParam []PathParam
+	var strict bool
 	var file []FileUpload
+	var progress ProgressFunc
 	for _, p := range v {
 		switch t := p.(type) {
 		case Header:
@@ -147,6 +212,17 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 			}
 		case http.Header:
 			req.Header = t
+		case PathParam:
+			pathParam = append(pathParam, t)
+		case strictPathParam:
+			strict = bool(t)
+		case dumpLimitOpt:
+			r.dumpLimit = int(t)
+		case context.Context:
+			req = req.WithContext(t)
+			r.req = req
+		case ProgressFunc:
+			progress = t
 		case io.Reader:
 			var rc io.ReadCloser
 			if trc, ok := t.(io.ReadCloser); ok {
@@ -154,18 +230,10 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 			} else {
 				rc = ioutil.NopCloser(t)
 			}
-			req.Body = bodyWrapper{
-				ReadCloser: rc,
-				limit:      102400,
-			}
-			bs, err := ioutil.ReadAll(t)
-			if err != nil {
-				return nil, err
-			}
-			handleBody(&body{Data: bs})
-			if rc, ok := t.(io.ReadCloser); ok {
-				rc.Close()
-			}
+			bw := &bodyWrapper{ReadCloser: rc, limit: r.dumpLimit}
+			req.Body = bw
+			r.reqCapture = bw
+			r.unbufferedBody = true
 		case *body:
 			handleBody(t)
 		case Param:
@@ -199,8 +267,29 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 		}
 	}
 
+	if len(pathParam) > 0 || strict {
+		merged := make(map[string]string)
+		for _, p := range pathParam {
+			for key, value := range p {
+				merged[key] = value
+			}
+		}
+		rawurl = regPathParam.ReplaceAllStringFunc(rawurl, func(token string) string {
+			key := token[1 : len(token)-1]
+			if value, ok := merged[key]; ok {
+				return url.PathEscape(value)
+			}
+			return token
+		})
+		if strict {
+			if loc := regPathParam.FindString(rawurl); loc != "" {
+				return nil, fmt.Errorf("req: unresolved path param %s in %q", loc, rawurl)
+			}
+		}
+	}
+
 	if len(file) > 0 && (req.Method == "POST" || req.Method == "PUT") {
-		r.upload(file, formParam)
+		r.upload(file, formParam, progress)
 	}
 
 	if len(formParam) > 0 {
@@ -250,22 +339,44 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 	}
 	req.URL = u
 
+	return r, err
+}
+
+// dispatch performs the actual round trip for r, falling back to the
+// default client's http.Client when none was set via buildReq, then reads
+// the response body when its Content-Type looks like text/json/xml or
+// matches a codec registered on r's owning Client, and prints the debug
+// dump when Debug is enabled.
+func dispatch(r *Req) (*Req, error) {
 	if r.client == nil {
-		r.client = defaultClient
+		r.client = defaultClient.HTTPClient
 	}
 
+	// A retried request must not leak the previous attempt's response
+	// into the caller's hands if this attempt fails before producing one.
+	r.resp = nil
+	r.respBody = nil
+
 	now := time.Now()
-	resp, errDo := r.client.Do(req)
+	resp, errDo := r.client.Do(r.req)
 	r.cost = time.Since(now)
-	if err != nil {
-		return r, err
+	// After a failed round trip the transport may never have drained the
+	// upload pipe, so the upload goroutine may never finish.
+	if r.uploadErrCh != nil && errDo == nil {
+		if uploadErr := <-r.uploadErrCh; uploadErr != nil {
+			errDo = uploadErr
+		}
 	}
 	if errDo != nil {
 		return r, errDo
 	}
 	r.resp = resp
 	ct := resp.Header.Get("Content-Type")
-	if ct == "" || regTextContentType.MatchString(ct) {
+	client := r.owner
+	if client == nil {
+		client = defaultClient
+	}
+	if ct == "" || regTextContentType.MatchString(ct) || client.codecFor(ct) != nil {
 		respBody, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return r, err
@@ -275,7 +386,7 @@ func Do(method, rawurl string, v ...interface{}) (r *Req, err error) {
 	if Debug {
 		fmt.Println(r.dump())
 	}
-	return
+	return r, nil
 }
 
 type dummyMultipart struct {
@@ -315,17 +426,48 @@ func newDummyMultipart() *dummyMultipart {
 	return d
 }
 
-func (r *Req) upload(file []FileUpload, param []Param) {
+func (r *Req) upload(file []FileUpload, param []Param, progress ProgressFunc) {
+	r.multipart = true
+	r.uploadErrCh = make(chan error, 1)
+
+	var total int64
+	sizeKnown := true
+	for _, f := range file {
+		switch {
+		case f.Size > 0:
+			total += f.Size
+		default:
+			if osFile, ok := f.File.(*os.File); ok {
+				if stat, err := osFile.Stat(); err == nil {
+					total += stat.Size()
+					continue
+				}
+			}
+			sizeKnown = false
+		}
+	}
+	if !sizeKnown {
+		total = 0
+	}
+
 	pr, pw := io.Pipe()
 	bodyWriter := multipart.NewWriter(pw)
 	d := newDummyMultipart()
 	go func() {
+		fail := func(err error) {
+			pw.CloseWithError(err)
+			r.uploadErrCh <- err
+		}
 		for _, p := range param {
 			for key, value := range p {
-				bodyWriter.WriteField(key, value)
+				if err := bodyWriter.WriteField(key, value); err != nil {
+					fail(err)
+					return
+				}
 				d.WriteField(key, value)
 			}
 		}
+		var written int64
 		i := 0
 		for _, f := range file {
 			if f.FieldName == "" {
@@ -334,21 +476,36 @@ func (r *Req) upload(file []FileUpload, param []Param) {
 			}
 			fileWriter, err := bodyWriter.CreateFormFile(f.FieldName, f.FileName)
 			if err != nil {
+				fail(err)
 				return
 			}
-			//iocopy
-			_, err = io.Copy(fileWriter, f.File)
+			var w io.Writer = fileWriter
+			if progress != nil {
+				base := written
+				w = NewProgressWriter(fileWriter, total, func(n, t int64) {
+					progress(base+n, t)
+				})
+			}
+			n, err := io.Copy(w, f.File)
 			if err != nil {
+				fail(err)
 				return
 			}
+			written += n
 			f.File.Close()
 			d.WriteFile(f.FieldName, f.FileName)
 		}
 		bodyWriter.Close()
 		pw.Close()
 		r.reqBody = d.buf.Bytes()
+		r.uploadErrCh <- nil
 	}()
 	r.req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+	if sizeKnown {
+		if n, ok := multipartContentLength(bodyWriter.Boundary(), param, file, total); ok {
+			r.req.ContentLength = n
+		}
+	}
 	r.req.Body = ioutil.NopCloser(pr)
 }
 
@@ -459,15 +616,107 @@ func (r *Req) ToXML(v interface{}) error {
 
 // ToFile download the response body to file
 func (r *Req) ToFile(name string) error {
+	return r.ToFileWithProgress(name, nil)
+}
+
+// ToFileWithProgress downloads the response body to file name, calling fn
+// after each chunk written with the bytes written so far and the total
+// size (the length of the already-read body, else the response's
+// Content-Length, 0 if unknown). It also
+// covers the case where the body was already auto-read into r.respBody
+// (see Do), which ToFile used to silently return empty for.
+func (r *Req) ToFileWithProgress(name string, fn ProgressFunc) error {
 	file, err := os.Create(name)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(file, r.resp.Body)
-	if err != nil {
+	defer file.Close()
+
+	total := int64(len(r.respBody))
+	if r.respBody == nil && r.resp != nil && r.resp.ContentLength > 0 {
+		total = r.resp.ContentLength
+	}
+
+	var w io.Writer = file
+	if fn != nil {
+		w = NewProgressWriter(file, total, fn)
+	}
+
+	if r.respBody != nil {
+		_, err = w.Write(r.respBody)
 		return err
 	}
-	return nil
+	_, err = io.Copy(w, r.resp.Body)
+	return err
+}
+
+// truncateForDump slices data down to at most limit bytes for display,
+// returning the shown prefix and how many trailing bytes were dropped.
+// limit<0 means unlimited, limit==0 drops everything.
+func truncateForDump(data []byte, limit int) (shown []byte, truncated int64) {
+	switch {
+	case limit < 0 || len(data) <= limit:
+		return data, 0
+	case limit == 0:
+		return nil, int64(len(data))
+	default:
+		return data[:limit], int64(len(data) - limit)
+	}
+}
+
+// dump renders a full, human-readable representation of the request and
+// its response: method, URL, headers, and bodies, truncated to dumpLimit
+// with a "... (truncated N bytes)" marker when the cap was hit.
+func (r *Req) dump() string {
+	var buf bytes.Buffer
+	req := r.req
+	fmt.Fprintln(&buf, req.Method, req.URL.String())
+	for key, values := range req.Header {
+		for _, value := range values {
+			fmt.Fprintf(&buf, "%s: %s\n", key, value)
+		}
+	}
+
+	var reqShown []byte
+	var reqTruncated int64
+	if r.reqCapture != nil {
+		reqShown, reqTruncated = r.reqCapture.buf.Bytes(), r.reqCapture.truncated
+	} else if len(r.reqBody) > 0 {
+		reqShown, reqTruncated = truncateForDump(r.reqBody, r.dumpLimit)
+	}
+	if len(reqShown) > 0 || reqTruncated > 0 {
+		fmt.Fprintln(&buf)
+		buf.Write(reqShown)
+		if reqTruncated > 0 {
+			fmt.Fprintf(&buf, "\n... (truncated %d bytes)", reqTruncated)
+		}
+		fmt.Fprintln(&buf)
+	}
+
+	if r.resp != nil {
+		fmt.Fprintln(&buf)
+		fmt.Fprintln(&buf, r.resp.Proto, r.resp.Status)
+		for key, values := range r.resp.Header {
+			for _, value := range values {
+				fmt.Fprintf(&buf, "%s: %s\n", key, value)
+			}
+		}
+		respShown, respTruncated := truncateForDump(r.respBody, r.dumpLimit)
+		if len(respShown) > 0 || respTruncated > 0 {
+			fmt.Fprintln(&buf)
+			buf.Write(respShown)
+			if respTruncated > 0 {
+				fmt.Fprintf(&buf, "\n... (truncated %d bytes)", respTruncated)
+			}
+			fmt.Fprintln(&buf)
+		}
+	}
+
+	if ShowCost {
+		fmt.Fprintln(&buf, "cost:", r.cost)
+	}
+
+	return buf.String()
 }
 
 var regNewline = regexp.MustCompile(`\n|\r`)
@@ -0,0 +1,50 @@
+package req
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestStreamedRequestBodyCaptureTruncates sends a request body larger than
+// the default DumpBodyLimit through an io.Reader and checks that the full
+// body still reaches the wire unmodified while the captured dump is capped
+// at the limit, with a truncation marker for the dropped bytes.
+func TestStreamedRequestBodyCaptureTruncates(t *testing.T) {
+	const size = 150 * 1024 // > default 100 KiB DumpBodyLimit
+	payload := strings.Repeat("a", size)
+
+	var wireBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatalf("server: read request body: %v", err)
+		}
+		wireBody = body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	r, err := Post(srv.URL, strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+
+	if !bytes.Equal(wireBody, []byte(payload)) {
+		t.Fatalf("wire body: got %d bytes, want the full %d byte payload unchanged", len(wireBody), size)
+	}
+
+	dump := r.dump()
+	if strings.Contains(dump, payload) {
+		t.Fatalf("dump: expected the captured body to be truncated, got the full %d bytes", size)
+	}
+	wantTruncated := size - 100*1024
+	marker := fmt.Sprintf("truncated %d bytes", wantTruncated)
+	if !strings.Contains(dump, marker) {
+		t.Fatalf("dump: expected marker %q, got:\n%s", marker, dump)
+	}
+}
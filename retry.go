@@ -0,0 +1,153 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures automatic retries for requests made through a
+// Client. MaxRetries is the number of retries after the initial attempt (so
+// MaxRetries=2 allows up to 3 total attempts). WaitTime and MaxWaitTime
+// bound the exponential backoff between attempts. RetryConditions decide,
+// given the *Req and any error dispatch returned, whether the attempt
+// should be retried; when nil it defaults to retrying on network errors and
+// 5xx/429 responses.
+type RetryPolicy struct {
+	MaxRetries      int
+	WaitTime        time.Duration
+	MaxWaitTime     time.Duration
+	RetryConditions []func(*Req, error) bool
+}
+
+// ErrRetryUnsupportedBody is returned when a RetryPolicy would retry a
+// request whose body cannot be rewound, such as a streamed multipart
+// upload that was not buffered.
+type ErrRetryUnsupportedBody struct {
+	reason string
+}
+
+func (e *ErrRetryUnsupportedBody) Error() string {
+	return "req: cannot retry request: " + e.reason
+}
+
+func defaultRetryConditions() []func(*Req, error) bool {
+	return []func(*Req, error) bool{
+		func(r *Req, err error) bool {
+			if err != nil {
+				// A canceled/expired context means the caller (or
+				// Client.Timeout) gave up on the request entirely; retrying
+				// would just burn attempts and backoff sleep on an error
+				// that can never succeed.
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					return false
+				}
+				return true
+			}
+			if r.resp == nil {
+				return false
+			}
+			return r.resp.StatusCode == http.StatusTooManyRequests || r.resp.StatusCode >= 500
+		},
+	}
+}
+
+// doWithRetry dispatches r, retrying according to c.Retry until a retry
+// condition says to stop or MaxRetries is exhausted.
+func (c *Client) doWithRetry(r *Req) (*Req, error) {
+	conditions := c.Retry.RetryConditions
+	if conditions == nil {
+		conditions = defaultRetryConditions()
+	}
+
+	var err error
+	for {
+		r.attempt++
+		r, err = dispatch(r)
+		if r.attempt > c.Retry.MaxRetries || !shouldRetry(r, err, conditions) {
+			return r, err
+		}
+		if r.multipart {
+			return r, &ErrRetryUnsupportedBody{reason: "multipart upload body was streamed, not buffered"}
+		}
+		if r.unbufferedBody {
+			return r, &ErrRetryUnsupportedBody{reason: "io.Reader request body was streamed, not buffered"}
+		}
+		wait := retryWait(r.attempt, c.Retry.WaitTime, c.Retry.MaxWaitTime, r.resp)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-r.req.Context().Done():
+			timer.Stop()
+			return r, r.req.Context().Err()
+		}
+		r.rewind()
+	}
+}
+
+func shouldRetry(r *Req, err error, conditions []func(*Req, error) bool) bool {
+	for _, cond := range conditions {
+		if cond(r, err) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryWait computes the exponential backoff with full jitter for attempt
+// n (n starts at 1): min(maxWait, rand.Int63n(wait * 2^(n-1))), honoring a
+// Retry-After header (seconds or an HTTP-date) on resp when present.
+func retryWait(n int, wait, maxWait time.Duration, resp *http.Response) time.Duration {
+	if resp != nil {
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil {
+				return capWait(time.Duration(secs)*time.Second, maxWait)
+			}
+			if t, err := http.ParseTime(ra); err == nil {
+				d := time.Until(t)
+				if d < 0 {
+					d = 0
+				}
+				return capWait(d, maxWait)
+			}
+		}
+	}
+	if wait <= 0 {
+		wait = 100 * time.Millisecond
+	}
+	// maxWait caps the drawn value, not the range it is drawn from.
+	upper := exponentialUpper(wait, 0, n)
+	return capWait(time.Duration(rand.Int63n(int64(upper))), maxWait)
+}
+
+// exponentialUpper returns wait*2^(n-1), the upper bound of the backoff
+// range for attempt n, stopping early at maxWait (when set) or at
+// math.MaxInt64 so a large n (e.g. a high MaxRetries) can't overflow
+// time.Duration into a negative value.
+func exponentialUpper(wait, maxWait time.Duration, n int) time.Duration {
+	upper := wait
+	for i := 1; i < n; i++ {
+		if maxWait > 0 && upper >= maxWait {
+			return maxWait
+		}
+		if upper > time.Duration(math.MaxInt64)/2 {
+			break
+		}
+		upper *= 2
+	}
+	if maxWait > 0 && upper > maxWait {
+		return maxWait
+	}
+	return upper
+}
+
+func capWait(d, maxWait time.Duration) time.Duration {
+	if maxWait > 0 && d > maxWait {
+		return maxWait
+	}
+	return d
+}